@@ -0,0 +1,559 @@
+// Package asm implements a two-pass assembler and disassembler for the
+// LC-3 instruction set. Assemble's output is the word sequence of the
+// object format LC3RAM.Load consumes; written to a file as big-endian
+// 16-bit words, a program assembled here can be run by the vm package
+// without going through any other toolchain.
+package asm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/idexter/golang-lc3-vm/vm"
+)
+
+// sourceLine is one non-blank, comment-stripped source line: an optional
+// label, an optional mnemonic with its operands, and the line number it
+// came from, for error messages.
+type sourceLine struct {
+	num      int
+	label    string
+	mnemonic string
+	operands []string
+}
+
+// Assemble reads LC-3 assembly source from src and returns the assembled
+// object image: the origin address set by .ORIG, followed by one word
+// per instruction or data directive, in the order LC3RAM.Load expects to
+// read them from an object file (origin first, then the program words).
+// The words are returned as values; writing them out big-endian is left
+// to the caller.
+func Assemble(src io.Reader) ([]uint16, error) {
+	lines, err := tokenize(src)
+	if err != nil {
+		return nil, err
+	}
+	if len(lines) == 0 || lines[0].mnemonic != ".ORIG" {
+		return nil, fmt.Errorf("asm: program must start with .ORIG")
+	}
+	origin, err := parseWord(lines[0].operands, 1, 16)
+	if err != nil {
+		return nil, fmt.Errorf("asm: line %d: .ORIG: %w", lines[0].num, err)
+	}
+	lines = lines[1:]
+
+	symbols, placed, err := resolveSymbols(lines, uint16(origin))
+	if err != nil {
+		return nil, err
+	}
+
+	prog := []uint16{uint16(origin)}
+	for _, p := range placed {
+		words, err := encode(p.line, p.addr, symbols)
+		if err != nil {
+			return nil, err
+		}
+		prog = append(prog, words...)
+	}
+	return prog, nil
+}
+
+// placedLine is a sourceLine together with the address its first word
+// will be assembled to.
+type placedLine struct {
+	addr uint16
+	line sourceLine
+}
+
+// resolveSymbols runs the assembler's first pass: it walks lines in
+// order, assigning each label the address of the line it decorates and
+// each instruction/directive the address of its first word, stopping at
+// .END. It returns the symbol table and the lines that still need
+// encoding.
+func resolveSymbols(lines []sourceLine, origin uint16) (map[string]uint16, []placedLine, error) {
+	symbols := make(map[string]uint16)
+	var placed []placedLine
+	addr := origin
+
+	for _, ln := range lines {
+		if ln.label != "" {
+			if _, dup := symbols[ln.label]; dup {
+				return nil, nil, fmt.Errorf("asm: line %d: label %q redefined", ln.num, ln.label)
+			}
+			symbols[ln.label] = addr
+		}
+		if ln.mnemonic == "" {
+			continue
+		}
+		if ln.mnemonic == ".END" {
+			return symbols, placed, nil
+		}
+
+		size, err := wordSize(ln)
+		if err != nil {
+			return nil, nil, err
+		}
+		placed = append(placed, placedLine{addr: addr, line: ln})
+		addr += size
+	}
+	return nil, nil, fmt.Errorf("asm: program is missing .END")
+}
+
+// wordSize returns how many words ln assembles to.
+func wordSize(ln sourceLine) (uint16, error) {
+	switch ln.mnemonic {
+	case ".BLKW":
+		n, err := parseWord(ln.operands, 1, 16)
+		if err != nil {
+			return 0, fmt.Errorf("asm: line %d: .BLKW: %w", ln.num, err)
+		}
+		return uint16(n), nil
+	case ".STRINGZ":
+		if len(ln.operands) != 1 {
+			return 0, fmt.Errorf("asm: line %d: .STRINGZ: want one quoted string operand", ln.num)
+		}
+		s, err := unquote(ln.operands[0])
+		if err != nil {
+			return 0, fmt.Errorf("asm: line %d: .STRINGZ: %w", ln.num, err)
+		}
+		return uint16(len(s) + 1), nil
+	default:
+		return 1, nil
+	}
+}
+
+// tokenize reads src into sourceLines, stripping comments and blank
+// lines, and splitting each remaining line into a label (if any), a
+// mnemonic, and its operands.
+func tokenize(src io.Reader) ([]sourceLine, error) {
+	var lines []sourceLine
+	scanner := bufio.NewScanner(src)
+	num := 0
+	for scanner.Scan() {
+		num++
+		text := stripComment(scanner.Text())
+		fields, err := splitFields(text)
+		if err != nil {
+			return nil, fmt.Errorf("asm: line %d: %w", num, err)
+		}
+		if len(fields) == 0 {
+			continue
+		}
+
+		ln := sourceLine{num: num}
+		if !isMnemonic(fields[0]) {
+			ln.label = fields[0]
+			fields = fields[1:]
+		}
+		if len(fields) > 0 {
+			ln.mnemonic = strings.ToUpper(fields[0])
+			ln.operands = fields[1:]
+		}
+		lines = append(lines, ln)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("asm: %w", err)
+	}
+	return lines, nil
+}
+
+// stripComment removes everything from the first ';' onward.
+func stripComment(s string) string {
+	if i := strings.IndexByte(s, ';'); i >= 0 {
+		s = s[:i]
+	}
+	return strings.TrimSpace(s)
+}
+
+// splitFields splits a line on whitespace and commas, keeping a
+// double-quoted string (as used by .STRINGZ) together as one field.
+func splitFields(s string) ([]string, error) {
+	var fields []string
+	for len(s) > 0 {
+		s = strings.TrimLeft(s, " \t,")
+		if s == "" {
+			break
+		}
+		if s[0] == '"' {
+			end := -1
+			for i := 1; i < len(s); i++ {
+				if s[i] == '\\' {
+					i++
+					continue
+				}
+				if s[i] == '"' {
+					end = i
+					break
+				}
+			}
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated string literal")
+			}
+			fields = append(fields, s[:end+1])
+			s = s[end+1:]
+			continue
+		}
+		i := strings.IndexAny(s, " \t,")
+		if i < 0 {
+			i = len(s)
+		}
+		fields = append(fields, s[:i])
+		s = s[i:]
+	}
+	return fields, nil
+}
+
+// mnemonics is the set of opcode, trap alias and directive names
+// isMnemonic recognizes; BR's N/Z/P suffixed forms are matched
+// separately, by isBranchMnemonic.
+var mnemonics = map[string]bool{
+	"ADD": true, "AND": true, "NOT": true, "BR": true,
+	"JMP": true, "RET": true, "JSR": true, "JSRR": true,
+	"LD": true, "LDI": true, "LDR": true, "LEA": true,
+	"ST": true, "STI": true, "STR": true,
+	"TRAP": true, "RTI": true,
+	"GETC": true, "OUT": true, "PUTS": true, "IN": true, "PUTSP": true, "HALT": true,
+	".ORIG": true, ".FILL": true, ".BLKW": true, ".STRINGZ": true, ".END": true,
+}
+
+// isMnemonic reports whether tok names an opcode/directive rather than a
+// label, which is how the assembler tells apart "LOOP ADD R0,R0,#1" from
+// "ADD R0,R0,#1".
+func isMnemonic(tok string) bool {
+	up := strings.ToUpper(tok)
+	if mnemonics[up] {
+		return true
+	}
+	return isBranchMnemonic(up)
+}
+
+// isBranchMnemonic reports whether up is BR optionally followed by any
+// combination of N, Z, and P, e.g. BR, BRz, BRnzp.
+func isBranchMnemonic(up string) bool {
+	if !strings.HasPrefix(up, "BR") {
+		return false
+	}
+	for _, c := range up[2:] {
+		if c != 'N' && c != 'Z' && c != 'P' {
+			return false
+		}
+	}
+	return true
+}
+
+// parseNumber parses operands[index] as an LC-3 numeric literal: #123 or
+// #-123 for decimal, x1F or 0x1F for hexadecimal.
+func parseNumber(operands []string, index int) (int64, error) {
+	if index-1 >= len(operands) {
+		return 0, fmt.Errorf("missing operand")
+	}
+	tok := operands[index-1]
+	var n int64
+	var err error
+	switch {
+	case strings.HasPrefix(tok, "#"):
+		n, err = strconv.ParseInt(tok[1:], 10, 32)
+	case strings.HasPrefix(tok, "x") || strings.HasPrefix(tok, "X"):
+		n, err = strconv.ParseInt(tok[1:], 16, 32)
+	case strings.HasPrefix(tok, "0x") || strings.HasPrefix(tok, "0X"):
+		n, err = strconv.ParseInt(tok[2:], 16, 32)
+	default:
+		n, err = strconv.ParseInt(tok, 10, 32)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("invalid immediate %q", tok)
+	}
+	return n, nil
+}
+
+// parseImm parses operands[index] as a signed immediate that must fit in
+// bits, e.g. ADD's imm5 or a PCoffset's literal form.
+func parseImm(operands []string, index, bits int) (int64, error) {
+	n, err := parseNumber(operands, index)
+	if err != nil {
+		return 0, err
+	}
+	if !fitsSigned(n, bits) {
+		return 0, fmt.Errorf("immediate %q does not fit in %d bits", operands[index-1], bits)
+	}
+	return n, nil
+}
+
+// parseWord parses operands[index] as a value that must fit in a plain
+// (unsigned) bits-wide field, e.g. .ORIG's address or .FILL's raw word.
+func parseWord(operands []string, index, bits int) (int64, error) {
+	n, err := parseNumber(operands, index)
+	if err != nil {
+		return 0, err
+	}
+	if n < 0 || n > (int64(1)<<uint(bits))-1 {
+		return 0, fmt.Errorf("value %q does not fit in %d bits", operands[index-1], bits)
+	}
+	return n, nil
+}
+
+func fitsSigned(n int64, bits int) bool {
+	min := int64(-1) << (bits - 1)
+	max := (int64(1) << (bits - 1)) - 1
+	return n >= min && n <= max
+}
+
+// unquote strips the surrounding quotes from a .STRINGZ operand and
+// interprets its backslash escapes (\n, \t, \\, \").
+func unquote(tok string) (string, error) {
+	if len(tok) < 2 || tok[0] != '"' || tok[len(tok)-1] != '"' {
+		return "", fmt.Errorf("expected a quoted string, got %q", tok)
+	}
+	return strconv.Unquote(tok)
+}
+
+// parseReg parses operands[index] as a register name (R0-R7).
+func parseReg(operands []string, index int) (uint16, error) {
+	if index-1 >= len(operands) {
+		return 0, fmt.Errorf("missing register operand")
+	}
+	tok := strings.ToUpper(operands[index-1])
+	if len(tok) != 2 || tok[0] != 'R' || tok[1] < '0' || tok[1] > '7' {
+		return 0, fmt.Errorf("invalid register %q", operands[index-1])
+	}
+	return uint16(tok[1] - '0'), nil
+}
+
+// label resolves operands[index] against symbols, returning the target
+// address.
+func label(operands []string, index int, symbols map[string]uint16) (uint16, error) {
+	if index-1 >= len(operands) {
+		return 0, fmt.Errorf("missing label operand")
+	}
+	name := operands[index-1]
+	addr, ok := symbols[name]
+	if !ok {
+		return 0, fmt.Errorf("undefined label %q", name)
+	}
+	return addr, nil
+}
+
+// pcOffset computes the signed PCoffset from the instruction at addr
+// (whose PC, by the time the instruction executes, has already advanced
+// past it) to target, and checks it fits in bits.
+func pcOffset(addr, target uint16, bits int) (uint16, error) {
+	off := int64(int32(target) - int32(addr) - 1)
+	if !fitsSigned(off, bits) {
+		return 0, fmt.Errorf("branch target out of range (%d does not fit in %d bits)", off, bits)
+	}
+	return uint16(off) & ((1 << uint(bits)) - 1), nil
+}
+
+// encode assembles one placed line into its word(s).
+func encode(ln sourceLine, addr uint16, symbols map[string]uint16) ([]uint16, error) {
+	words, err := encodeLine(ln, addr, symbols)
+	if err != nil {
+		return nil, fmt.Errorf("asm: line %d: %w", ln.num, err)
+	}
+	return words, nil
+}
+
+func encodeLine(ln sourceLine, addr uint16, symbols map[string]uint16) ([]uint16, error) {
+	switch {
+	case ln.mnemonic == ".FILL":
+		v, err := parseWord(ln.operands, 1, 16)
+		if err != nil {
+			return nil, err
+		}
+		return []uint16{uint16(v)}, nil
+
+	case ln.mnemonic == ".BLKW":
+		n, err := parseWord(ln.operands, 1, 16)
+		if err != nil {
+			return nil, err
+		}
+		return make([]uint16, n), nil
+
+	case ln.mnemonic == ".STRINGZ":
+		s, err := unquote(ln.operands[0])
+		if err != nil {
+			return nil, err
+		}
+		words := make([]uint16, len(s)+1)
+		for i, r := range []byte(s) {
+			words[i] = uint16(r)
+		}
+		return words, nil
+
+	case ln.mnemonic == "ADD" || ln.mnemonic == "AND":
+		op := vm.OP_ADD
+		if ln.mnemonic == "AND" {
+			op = vm.OP_AND
+		}
+		dr, err := parseReg(ln.operands, 1)
+		if err != nil {
+			return nil, err
+		}
+		sr1, err := parseReg(ln.operands, 2)
+		if err != nil {
+			return nil, err
+		}
+		if len(ln.operands) < 3 {
+			return nil, fmt.Errorf("missing third operand")
+		}
+		if strings.HasPrefix(ln.operands[2], "R") || strings.HasPrefix(ln.operands[2], "r") {
+			sr2, err := parseReg(ln.operands, 3)
+			if err != nil {
+				return nil, err
+			}
+			return []uint16{op<<12 | dr<<9 | sr1<<6 | sr2}, nil
+		}
+		imm5, err := parseImm(ln.operands, 3, 5)
+		if err != nil {
+			return nil, err
+		}
+		return []uint16{op<<12 | dr<<9 | sr1<<6 | 1<<5 | uint16(imm5)&0x1F}, nil
+
+	case ln.mnemonic == "NOT":
+		dr, err := parseReg(ln.operands, 1)
+		if err != nil {
+			return nil, err
+		}
+		sr, err := parseReg(ln.operands, 2)
+		if err != nil {
+			return nil, err
+		}
+		return []uint16{vm.OP_NOT<<12 | dr<<9 | sr<<6 | 0x3F}, nil
+
+	case isBranchMnemonic(ln.mnemonic):
+		mask := branchMask(ln.mnemonic)
+		target, err := label(ln.operands, 1, symbols)
+		if err != nil {
+			return nil, err
+		}
+		off, err := pcOffset(addr, target, 9)
+		if err != nil {
+			return nil, err
+		}
+		return []uint16{vm.OP_BR<<12 | mask<<9 | off}, nil
+
+	case ln.mnemonic == "JMP":
+		r, err := parseReg(ln.operands, 1)
+		if err != nil {
+			return nil, err
+		}
+		return []uint16{vm.OP_JMP<<12 | r<<6}, nil
+
+	case ln.mnemonic == "RET":
+		return []uint16{vm.OP_JMP<<12 | 7<<6}, nil
+
+	case ln.mnemonic == "JSR":
+		target, err := label(ln.operands, 1, symbols)
+		if err != nil {
+			return nil, err
+		}
+		off, err := pcOffset(addr, target, 11)
+		if err != nil {
+			return nil, err
+		}
+		return []uint16{vm.OP_JSR<<12 | 1<<11 | off}, nil
+
+	case ln.mnemonic == "JSRR":
+		r, err := parseReg(ln.operands, 1)
+		if err != nil {
+			return nil, err
+		}
+		return []uint16{vm.OP_JSR<<12 | r<<6}, nil
+
+	case ln.mnemonic == "LD" || ln.mnemonic == "LDI" || ln.mnemonic == "ST" || ln.mnemonic == "STI" || ln.mnemonic == "LEA":
+		op := map[string]uint16{"LD": vm.OP_LD, "LDI": vm.OP_LDI, "ST": vm.OP_ST, "STI": vm.OP_STI, "LEA": vm.OP_LEA}[ln.mnemonic]
+		r, err := parseReg(ln.operands, 1)
+		if err != nil {
+			return nil, err
+		}
+		target, err := label(ln.operands, 2, symbols)
+		if err != nil {
+			return nil, err
+		}
+		off, err := pcOffset(addr, target, 9)
+		if err != nil {
+			return nil, err
+		}
+		return []uint16{op<<12 | r<<9 | off}, nil
+
+	case ln.mnemonic == "LDR" || ln.mnemonic == "STR":
+		op := vm.OP_LDR
+		if ln.mnemonic == "STR" {
+			op = vm.OP_STR
+		}
+		r0, err := parseReg(ln.operands, 1)
+		if err != nil {
+			return nil, err
+		}
+		r1, err := parseReg(ln.operands, 2)
+		if err != nil {
+			return nil, err
+		}
+		off, err := parseImm(ln.operands, 3, 6)
+		if err != nil {
+			return nil, err
+		}
+		return []uint16{op<<12 | r0<<9 | r1<<6 | uint16(off)&0x3F}, nil
+
+	case ln.mnemonic == "RTI":
+		return []uint16{vm.OP_RTI << 12}, nil
+
+	case ln.mnemonic == "TRAP":
+		v, err := parseWord(ln.operands, 1, 8)
+		if err != nil {
+			return nil, err
+		}
+		return []uint16{vm.OP_TRAP<<12 | uint16(v)&0xFF}, nil
+
+	case trapAlias(ln.mnemonic) != 0:
+		return []uint16{vm.OP_TRAP<<12 | trapAlias(ln.mnemonic)}, nil
+
+	default:
+		return nil, fmt.Errorf("unknown mnemonic %q", ln.mnemonic)
+	}
+}
+
+// branchMask returns BR's 3-bit N/Z/P condition mask for a mnemonic like
+// "BR", "BRz", or "BRnzp".
+func branchMask(mnemonic string) uint16 {
+	suffix := mnemonic[2:]
+	if suffix == "" {
+		return vm.FL_NEG | vm.FL_ZRO | vm.FL_POS
+	}
+	var mask uint16
+	for _, c := range suffix {
+		switch c {
+		case 'N':
+			mask |= vm.FL_NEG
+		case 'Z':
+			mask |= vm.FL_ZRO
+		case 'P':
+			mask |= vm.FL_POS
+		}
+	}
+	return mask
+}
+
+// trapAlias returns the trap vector for one of the OS trap mnemonics, or
+// 0 if mnemonic isn't one.
+func trapAlias(mnemonic string) uint16 {
+	switch mnemonic {
+	case "GETC":
+		return vm.TRAP_GETC
+	case "OUT":
+		return vm.TRAP_OUT
+	case "PUTS":
+		return vm.TRAP_PUTS
+	case "IN":
+		return vm.TRAP_IN
+	case "PUTSP":
+		return vm.TRAP_PUTSP
+	case "HALT":
+		return vm.TRAP_HALT
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,97 @@
+package asm
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/idexter/golang-lc3-vm/vm"
+)
+
+func TestAssembleEncodesKnownOpcodes(t *testing.T) {
+	src := `.ORIG x3000
+LOOP    ADD R0, R0, #1
+        AND R1, R0, R2
+        NOT R2, R0
+        BRnzp LOOP
+        LD R3, LOOP
+        ST R3, LOOP
+        TRAP x25
+        RTI
+.END
+`
+	prog, err := Assemble(strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("Assemble: %v", err)
+	}
+	var branchOff, ldOff, stOff int16 = -4, -5, -6
+	want := []uint16{
+		0x3000, // origin
+		vm.OP_ADD<<12 | 0<<9 | 0<<6 | 1<<5 | 1,
+		vm.OP_AND<<12 | 1<<9 | 0<<6 | 2,
+		vm.OP_NOT<<12 | 2<<9 | 0<<6 | 0x3F,
+		vm.OP_BR<<12 | (vm.FL_NEG|vm.FL_ZRO|vm.FL_POS)<<9 | (0x1FF & uint16(branchOff)),
+		vm.OP_LD<<12 | 3<<9 | (0x1FF & uint16(ldOff)),
+		vm.OP_ST<<12 | 3<<9 | (0x1FF & uint16(stOff)),
+		vm.OP_TRAP<<12 | 0x25,
+		vm.OP_RTI << 12,
+	}
+	if len(prog) != len(want) {
+		t.Fatalf("len(prog) = %d, want %d: %04X", len(prog), len(want), prog)
+	}
+	for i := range want {
+		if prog[i] != want[i] {
+			t.Errorf("prog[%d] = %#04x, want %#04x", i, prog[i], want[i])
+		}
+	}
+}
+
+func TestAssembleRejectsOutOfRangeBranch(t *testing.T) {
+	src := ".ORIG x3000\nBR FAR\n.BLKW 400\nFAR ADD R0, R0, #0\n.END\n"
+	_, err := Assemble(strings.NewReader(src))
+	if err == nil {
+		t.Fatalf("Assemble: want error for out-of-range branch, got nil")
+	}
+}
+
+func TestAssembleResolvesTrapAliases(t *testing.T) {
+	src := ".ORIG x3000\nGETC\nOUT\nPUTS\nIN\nPUTSP\nHALT\n.END\n"
+	prog, err := Assemble(strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("Assemble: %v", err)
+	}
+	want := []uint16{0x3000,
+		vm.OP_TRAP<<12 | vm.TRAP_GETC,
+		vm.OP_TRAP<<12 | vm.TRAP_OUT,
+		vm.OP_TRAP<<12 | vm.TRAP_PUTS,
+		vm.OP_TRAP<<12 | vm.TRAP_IN,
+		vm.OP_TRAP<<12 | vm.TRAP_PUTSP,
+		vm.OP_TRAP<<12 | vm.TRAP_HALT,
+	}
+	for i := range want {
+		if prog[i] != want[i] {
+			t.Errorf("prog[%d] = %#04x, want %#04x", i, prog[i], want[i])
+		}
+	}
+}
+
+func TestDisassembleRoundTripsTrapAliases(t *testing.T) {
+	src := ".ORIG x3000\nGETC\nOUT\nPUTS\nIN\nPUTSP\nHALT\n.END\n"
+	prog, err := Assemble(strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("Assemble: %v", err)
+	}
+	out := Disassemble(prog[1:], prog[0])
+	for _, mnemonic := range []string{"GETC", "OUT", "PUTS", "IN", "PUTSP", "HALT"} {
+		if !strings.Contains(out, mnemonic) {
+			t.Errorf("disassembly missing %q:\n%s", mnemonic, out)
+		}
+	}
+}
+
+func TestDisassembleRendersBranchCondition(t *testing.T) {
+	instr := vm.OP_BR<<12 | (vm.FL_ZRO|vm.FL_POS)<<9 | 5
+	out := disassembleWord(instr)
+	if !strings.HasPrefix(out, "BRZP") {
+		t.Errorf("disassembleWord(%#04x) = %q, want prefix %q", instr, out, "BRZP")
+	}
+}
@@ -0,0 +1,57 @@
+package asm
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/idexter/golang-lc3-vm/vm"
+)
+
+// Disassemble decodes prog, a sequence of instruction/data words loaded
+// starting at origin, back into LC-3 assembly text: a leading .ORIG
+// directive, one address-prefixed line per word, and a trailing .END.
+// Since prog carries no information about which words are instructions
+// versus data, every word is decoded as an instruction; a .FILL/.BLKW
+// region will disassemble as whatever instruction its bits happen to
+// decode to.
+func Disassemble(prog []uint16, origin uint16) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, ".ORIG x%04X\n", origin)
+	for i, word := range prog {
+		addr := origin + uint16(i)
+		fmt.Fprintf(&b, "x%04X  %s\n", addr, disassembleWord(word))
+	}
+	b.WriteString(".END\n")
+	return b.String()
+}
+
+// disassembleWord renders instr the way vm.DisassembleWord does, except
+// for TRAP, where it resolves the vector to its OS alias mnemonic
+// (GETC, OUT, ...) instead of vm's raw "TRAP xNN" form.
+func disassembleWord(instr uint16) string {
+	if instr>>12 == vm.OP_TRAP {
+		return trapMnemonic(instr & 0xFF)
+	}
+	return vm.DisassembleWord(instr)
+}
+
+// trapMnemonic renders a trap vector as its OS alias if it has one,
+// falling back to the raw TRAP form.
+func trapMnemonic(vector uint16) string {
+	switch vector {
+	case vm.TRAP_GETC:
+		return "GETC"
+	case vm.TRAP_OUT:
+		return "OUT"
+	case vm.TRAP_PUTS:
+		return "PUTS"
+	case vm.TRAP_IN:
+		return "IN"
+	case vm.TRAP_PUTSP:
+		return "PUTSP"
+	case vm.TRAP_HALT:
+		return "HALT"
+	default:
+		return fmt.Sprintf("TRAP x%02X", vector)
+	}
+}
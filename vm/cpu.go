@@ -16,8 +16,8 @@ const (
 	R_R5
 	R_R6
 	R_R7
-	R_PC // program counter
-	R_COND
+	R_PC  // program counter
+	R_PSR // processor status register: privilege, priority level, N/Z/P
 	R_COUNT
 )
 
@@ -31,7 +31,7 @@ const (
 	OP_AND                // bitwise and
 	OP_LDR                // load register
 	OP_STR                // store register
-	OP_RTI                // unused
+	OP_RTI                // return from interrupt
 	OP_NOT                // bitwise not
 	OP_LDI                // load indirect
 	OP_STI                // store indirect
@@ -41,15 +41,48 @@ const (
 	OP_TRAP               // execute trap
 )
 
-// Condition Flags
+// Condition Flags, packed into the low 3 bits of the PSR.
 const (
 	FL_POS uint16 = 1 << 0 // Positive
 	FL_ZRO uint16 = 1 << 1 // Zero
 	FL_NEG uint16 = 1 << 2 // Negative
 )
 
+// PSR layout (LC-3b): privilege mode in bit 15, priority level in bits
+// [10:8], condition codes in bits [2:0].
+const (
+	PSR_COND_MASK      uint16 = FL_NEG | FL_ZRO | FL_POS
+	PSR_PRIORITY_SHIFT        = 8
+	PSR_PRIORITY_MASK  uint16 = 0x7 << PSR_PRIORITY_SHIFT
+	PSR_USER_MODE      uint16 = 1 << 15 // set: user mode, clear: supervisor mode
+)
+
 const PC_START uint16 = 0x3000
 
+// Conventional supervisor/user stack starting points: the supervisor
+// stack grows down from the OS's own memory, the user stack grows down
+// from just below the memory-mapped I/O region.
+const (
+	SSP_START uint16 = 0x3000
+	USP_START uint16 = 0xFE00
+)
+
+// InterruptVectorTableBase is the base address of the interrupt vector
+// table; Interrupt looks up the handler for vector at this address plus
+// the vector number.
+const InterruptVectorTableBase uint16 = 0x0100
+
+// VecKeyboard and PLKeyboard are the interrupt vector and priority level
+// the keyboard device requests, see KeyboardDevice.SetInterruptHandler.
+const (
+	VecKeyboard uint8 = 0x80
+	PLKeyboard  uint8 = 4
+)
+
+// TrapHandler handles a TRAP instruction for the vector it is registered
+// against, see LC3CPU.RegisterTrap.
+type TrapHandler func(cpu *LC3CPU)
+
 // LC3CPU describes CPU abstraction.
 type LC3CPU struct {
 	registers          [R_COUNT]uint16
@@ -59,101 +92,306 @@ type LC3CPU struct {
 	isRunning          bool
 	StartPosition      uint16
 	output             io.Writer
+	trapHandlers       map[uint8]TrapHandler
+	instructionHook    func(pc, instr uint16)
+	stepCount          uint64
+	ssp                uint16 // saved supervisor stack pointer
+	usp                uint16 // saved user stack pointer
+	tracer             Tracer
 }
 
 // NewCPU creates new LC-3 CPU instance.
 func NewCPU(ram *LC3RAM, output io.Writer) *LC3CPU {
-	return &LC3CPU{
+	v := &LC3CPU{
 		StartPosition: PC_START,
 		RAM:           ram,
 		output:        output,
+		ssp:           SSP_START,
+		usp:           USP_START,
+	}
+	v.registers[R_PSR] = PSR_USER_MODE
+	v.registerDefaultTraps()
+	v.wireKeyboardInterrupt()
+	return v
+}
+
+// wireKeyboardInterrupt connects the RAM's keyboard device, if any, so a
+// key becoming available while KBSR's interrupt-enable bit is set raises
+// an interrupt instead of only being visible to a program that polls
+// KBSR itself.
+func (v *LC3CPU) wireKeyboardInterrupt() {
+	kb := v.RAM.Keyboard()
+	if kb == nil {
+		return
+	}
+	kb.SetInterruptHandler(func() {
+		v.Interrupt(VecKeyboard, PLKeyboard)
+	})
+}
+
+// RegisterTrap installs h as the handler for the given trap vector,
+// overriding any existing handler for that vector, including the built-in
+// OS traps (GETC, OUT, PUTS, IN, PUTSP, HALT).
+func (v *LC3CPU) RegisterTrap(vector uint8, h TrapHandler) {
+	v.trapHandlers[vector] = h
+}
+
+// registerDefaultTraps installs the built-in LC-3 OS trap routines.
+func (v *LC3CPU) registerDefaultTraps() {
+	v.trapHandlers = map[uint8]TrapHandler{
+		TRAP_GETC:  (*LC3CPU).trapGetc,
+		TRAP_OUT:   (*LC3CPU).trapOut,
+		TRAP_PUTS:  (*LC3CPU).trapPuts,
+		TRAP_IN:    (*LC3CPU).trapIn,
+		TRAP_PUTSP: (*LC3CPU).trapPutsp,
+		TRAP_HALT:  (*LC3CPU).trapHalt,
 	}
 }
 
 // Reset resets CPU to initial state.
 func (v *LC3CPU) Reset() {
 	v.registers = [R_COUNT]uint16{}
-	v.RAM = &LC3RAM{
-		CheckKey: CheckKeyPressed,
-		GetChar:  GetCharFromStdin,
-	}
+	v.RAM = NewRAM(CheckKeyPressed, GetCharFromStdin)
 	v.currentInstruction = 0
 	v.currentOperation = 0
 	v.isRunning = false
+	v.stepCount = 0
+	v.ssp = SSP_START
+	v.usp = USP_START
+	v.registers[R_PSR] = PSR_USER_MODE
+	v.wireKeyboardInterrupt()
 }
 
-// Run runs CPU.
+// Run runs the CPU to completion, executing Step until HALT (or a bad
+// opcode) clears isRunning.
 func (v *LC3CPU) Run() {
 	// Set the PC to starting position
 	// 0x3000 is the default
 	v.registers[R_PC] = v.StartPosition
 	v.isRunning = true
 	for v.isRunning {
-		// Fetch
-		v.currentInstruction = v.RAM.Read(v.registers[R_PC])
-		if v.registers[R_PC] < MaxMemorySize {
-			v.registers[R_PC]++
+		v.Step()
+	}
+}
+
+// RunUntil runs the CPU, starting it if it isn't already running, until
+// StepCount reaches step or the CPU halts, whichever comes first. Unlike
+// Run, it does not reset an already-running CPU's PC, so it can resume a
+// Restore'd snapshot.
+func (v *LC3CPU) RunUntil(step uint64) {
+	if !v.isRunning {
+		v.registers[R_PC] = v.StartPosition
+		v.isRunning = true
+	}
+	for v.isRunning && v.stepCount < step {
+		v.Step()
+	}
+}
+
+// RunFor runs up to n more instructions from the current state, starting
+// the CPU first if it isn't already running, stopping early if it halts.
+func (v *LC3CPU) RunFor(n uint64) {
+	if !v.isRunning {
+		v.registers[R_PC] = v.StartPosition
+		v.isRunning = true
+	}
+	target := v.stepCount + n
+	for v.isRunning && v.stepCount < target {
+		v.Step()
+	}
+}
+
+// StepCount returns the number of instructions executed so far.
+func (v *LC3CPU) StepCount() uint64 {
+	return v.stepCount
+}
+
+// Step executes a single fetch-decode-execute cycle and returns whether
+// the CPU is still running afterwards. Unlike Run, Step does not load
+// the PC from StartPosition or mark the CPU as running: callers that
+// drive execution one instruction at a time (debuggers, REPLs) set R_PC
+// themselves, and Step reports false unless the CPU was started by Run,
+// RunUntil, RunFor or a Restore'd snapshot.
+func (v *LC3CPU) Step() bool {
+	if kb := v.RAM.Keyboard(); kb != nil {
+		kb.Poll()
+	}
+
+	pc := v.registers[R_PC]
+	v.stepCount++
+
+	// Fetch
+	v.currentInstruction = v.RAM.Read(pc)
+	if v.registers[R_PC] < MaxMemorySize {
+		v.registers[R_PC]++
+	}
+	v.currentOperation = v.currentInstruction >> 12
+
+	if v.instructionHook != nil {
+		v.instructionHook(pc, v.currentInstruction)
+	}
+
+	switch v.currentOperation {
+	case OP_ADD:
+		v.add()
+	case OP_AND:
+		v.and()
+	case OP_NOT:
+		v.not()
+	case OP_BR:
+		v.branch()
+	case OP_JMP:
+		v.jump()
+	case OP_JSR:
+		v.jumpRegister()
+	case OP_LD:
+		v.load()
+	case OP_LDI:
+		v.ldi()
+	case OP_LDR:
+		v.loadRegister()
+	case OP_LEA:
+		v.loadEffectiveAddress()
+	case OP_ST:
+		v.store()
+	case OP_STI:
+		v.storeIndirect()
+	case OP_STR:
+		v.storeRegister()
+	case OP_TRAP:
+		vector := uint8(v.currentInstruction & 0xFF)
+		if v.tracer != nil {
+			v.tracer.OnTrap(vector)
 		}
-		v.currentOperation = v.currentInstruction >> 12
-
-		switch v.currentOperation {
-		case OP_ADD:
-			v.add()
-		case OP_AND:
-			v.and()
-		case OP_NOT:
-			v.not()
-		case OP_BR:
-			v.branch()
-		case OP_JMP:
-			v.jump()
-		case OP_JSR:
-			v.jumpRegister()
-		case OP_LD:
-			v.load()
-		case OP_LDI:
-			v.ldi()
-		case OP_LDR:
-			v.loadRegister()
-		case OP_LEA:
-			v.loadEffectiveAddress()
-		case OP_ST:
-			v.store()
-		case OP_STI:
-			v.storeIndirect()
-		case OP_STR:
-			v.storeRegister()
-		case OP_TRAP:
-			switch v.currentInstruction & 0xFF {
-			case TRAP_GETC:
-				v.trapGetc()
-			case TRAP_OUT:
-				v.trapOut()
-			case TRAP_PUTS:
-				v.trapPuts()
-			case TRAP_IN:
-				v.trapIn()
-			case TRAP_PUTSP:
-				v.trapPutsp()
-			case TRAP_HALT:
-				v.trapHalt()
-			}
-		case OP_RES:
-		case OP_RTI:
-		default:
-			log.Printf("BAD OPCODE: %016b\n", v.currentOperation)
-			v.isRunning = false
+		if h, ok := v.trapHandlers[vector]; ok {
+			h(v)
+		} else {
+			log.Printf("BAD TRAP: %#x\n", vector)
 		}
+	case OP_RES:
+	case OP_RTI:
+		v.rti()
+	default:
+		log.Printf("BAD OPCODE: %016b\n", v.currentOperation)
+		v.isRunning = false
+	}
+
+	return v.isRunning
+}
+
+// OnInstruction registers a hook invoked after fetch and before execute on
+// every Step, with the address the instruction was fetched from and the
+// raw instruction word. Pass nil to remove it.
+func (v *LC3CPU) OnInstruction(h func(pc, instr uint16)) {
+	v.instructionHook = h
+}
+
+// SetTracer installs t to receive fetch, memory access, and trap events
+// as the CPU runs, by routing them through the same single-slot hooks a
+// Debugger uses: OnInstruction for fetches, and RAM.SetWriteHook/
+// SetReadHook for memory access, see Tracer. Like those hooks, it is a
+// single slot: installing a Tracer after a Debugger has wired itself to
+// the same CPU replaces the Debugger's hooks, not adds to them. Pass nil
+// to remove it, which also clears those hooks.
+func (v *LC3CPU) SetTracer(t Tracer) {
+	v.tracer = t
+	if t == nil {
+		v.OnInstruction(nil)
+		v.RAM.SetWriteHook(nil)
+		v.RAM.SetReadHook(nil)
+		return
 	}
+	v.OnInstruction(func(pc, instr uint16) { t.OnFetch(pc, instr) })
+	v.RAM.SetWriteHook(func(addr, _, newVal uint16) { t.OnMemWrite(addr, newVal) })
+	v.RAM.SetReadHook(func(addr, val uint16) { t.OnMemRead(addr, val) })
+}
+
+// PC returns the current program counter.
+func (v *LC3CPU) PC() uint16 {
+	return v.registers[R_PC]
+}
+
+// Registers returns a copy of the register file.
+func (v *LC3CPU) Registers() [R_COUNT]uint16 {
+	return v.registers
+}
+
+// SetRegister overwrites register r with val.
+func (v *LC3CPU) SetRegister(r, val uint16) {
+	v.registers[r] = val
 }
 
 func (v *LC3CPU) updateFlags(r uint16) {
+	v.registers[R_PSR] &^= PSR_COND_MASK
 	if v.registers[r] == 0 {
-		v.registers[R_COND] = FL_ZRO
+		v.registers[R_PSR] |= FL_ZRO
 	} else if v.registers[r]>>15 == uint16(1) { //* a 1 in the left-most bit indicates negative */
-		v.registers[R_COND] = FL_NEG
+		v.registers[R_PSR] |= FL_NEG
 	} else {
-		v.registers[R_COND] = FL_POS
+		v.registers[R_PSR] |= FL_POS
+	}
+}
+
+// priority returns the CPU's current priority level, from PSR[10:8].
+func (v *LC3CPU) priority() uint8 {
+	return uint8((v.registers[R_PSR] & PSR_PRIORITY_MASK) >> PSR_PRIORITY_SHIFT)
+}
+
+// userMode reports whether the CPU is currently running in user mode.
+func (v *LC3CPU) userMode() bool {
+	return v.registers[R_PSR]&PSR_USER_MODE != 0
+}
+
+// push decrements R6 (the active stack pointer) and writes val to the
+// newly-exposed address.
+func (v *LC3CPU) push(val uint16) {
+	v.registers[R_R6]--
+	v.RAM.Write(v.registers[R_R6], val)
+}
+
+// pop reads the value at R6 (the active stack pointer) and increments it.
+func (v *LC3CPU) pop() uint16 {
+	val := v.RAM.Read(v.registers[R_R6])
+	v.registers[R_R6]++
+	return val
+}
+
+// Interrupt requests an interrupt at the given vector with the given
+// priority level. Requests at or below the CPU's current priority level
+// are ignored. Otherwise it switches to supervisor mode (saving R6 as
+// USP and restoring SSP into R6 if it wasn't already), pushes the old
+// PSR and PC onto the supervisor stack, raises the priority level, and
+// jumps through the interrupt vector table at InterruptVectorTableBase.
+func (v *LC3CPU) Interrupt(vector uint8, priority uint8) {
+	if priority <= v.priority() {
+		return
+	}
+
+	oldPSR := v.registers[R_PSR]
+	if v.userMode() {
+		v.usp = v.registers[R_R6]
+		v.registers[R_R6] = v.ssp
+		v.registers[R_PSR] &^= PSR_USER_MODE
+	}
+
+	v.push(oldPSR)
+	v.push(v.registers[R_PC])
+
+	v.registers[R_PSR] = (v.registers[R_PSR] &^ PSR_PRIORITY_MASK) | (uint16(priority)<<PSR_PRIORITY_SHIFT)&PSR_PRIORITY_MASK
+	v.registers[R_PC] = v.RAM.Read(InterruptVectorTableBase + uint16(vector))
+}
+
+// rti implements OP_RTI: pop PC then PSR from the supervisor stack, and
+// if the restored PSR is back in user mode, swap R6 back to USP.
+func (v *LC3CPU) rti() {
+	pc := v.pop()
+	psr := v.pop()
+
+	v.registers[R_PC] = pc
+	v.registers[R_PSR] = psr
+	if v.userMode() {
+		v.ssp = v.registers[R_R6]
+		v.registers[R_R6] = v.usp
 	}
 }
 
@@ -168,7 +406,7 @@ func (v *LC3CPU) add() {
 	immFlag := (v.currentInstruction >> 5) & 0x1
 
 	if immFlag == 0x1 {
-		imm5 := signExtend(v.currentInstruction&0x1F, 5)
+		imm5 := SignExtend(v.currentInstruction&0x1F, 5)
 		v.registers[r0] = v.registers[r1] + imm5
 	} else {
 		r2 := v.currentInstruction & 0x7
@@ -184,7 +422,7 @@ func (v *LC3CPU) and() {
 	immFlag := (v.currentInstruction >> 5) & 0x1
 
 	if immFlag == 0x1 {
-		imm5 := signExtend(v.currentInstruction&0x1F, 5)
+		imm5 := SignExtend(v.currentInstruction&0x1F, 5)
 		v.registers[r0] = v.registers[r1] & imm5
 	} else {
 		r2 := v.currentInstruction & 0x7
@@ -202,9 +440,9 @@ func (v *LC3CPU) not() {
 }
 
 func (v *LC3CPU) branch() {
-	pcOffset := signExtend((v.currentInstruction)&0x1ff, 9)
+	pcOffset := SignExtend((v.currentInstruction)&0x1ff, 9)
 	condFlag := (v.currentInstruction >> 9) & 0x7
-	if (condFlag & v.registers[R_COND]) != 0 { // true
+	if (condFlag & (v.registers[R_PSR] & PSR_COND_MASK)) != 0 { // true
 		v.registers[R_PC] += pcOffset
 	}
 }
@@ -217,7 +455,7 @@ func (v *LC3CPU) jump() {
 
 func (v *LC3CPU) jumpRegister() {
 	r1 := (v.currentInstruction >> 6) & 0x7
-	longPcOffset := signExtend(v.currentInstruction&0x7ff, 11)
+	longPcOffset := SignExtend(v.currentInstruction&0x7ff, 11)
 	longFlag := (v.currentInstruction >> 11) & 1
 
 	v.registers[R_R7] = v.registers[R_PC]
@@ -230,7 +468,7 @@ func (v *LC3CPU) jumpRegister() {
 
 func (v *LC3CPU) load() {
 	r0 := (v.currentInstruction >> 9) & 0x7
-	pcOffset := signExtend(v.currentInstruction&0x1ff, 9)
+	pcOffset := SignExtend(v.currentInstruction&0x1ff, 9)
 	v.registers[r0] = v.RAM.Read(v.registers[R_PC] + pcOffset)
 	v.updateFlags(r0)
 }
@@ -239,7 +477,7 @@ func (v *LC3CPU) ldi() {
 	/* destination register (DR) */
 	r0 := (v.currentInstruction >> 9) & 0x7
 	/* PCoffset 9*/
-	pcOffset := signExtend(v.currentInstruction&0x1ff, 9)
+	pcOffset := SignExtend(v.currentInstruction&0x1ff, 9)
 	/* add pcOffset to the current PC, look at that RAM location to get the final address */
 	v.registers[r0] = v.RAM.Read(v.RAM.Read(v.registers[R_PC] + pcOffset))
 	v.updateFlags(r0)
@@ -248,34 +486,34 @@ func (v *LC3CPU) ldi() {
 func (v *LC3CPU) loadRegister() {
 	r0 := (v.currentInstruction >> 9) & 0x7
 	r1 := (v.currentInstruction >> 6) & 0x7
-	offset := signExtend(v.currentInstruction&0x3F, 6)
+	offset := SignExtend(v.currentInstruction&0x3F, 6)
 	v.registers[r0] = v.RAM.Read(v.registers[r1] + offset)
 	v.updateFlags(r0)
 }
 
 func (v *LC3CPU) loadEffectiveAddress() {
 	r0 := (v.currentInstruction >> 9) & 0x7
-	pcOffset := signExtend(v.currentInstruction&0x1ff, 9)
+	pcOffset := SignExtend(v.currentInstruction&0x1ff, 9)
 	v.registers[r0] = v.registers[R_PC] + pcOffset
 	v.updateFlags(r0)
 }
 
 func (v *LC3CPU) store() {
 	r0 := (v.currentInstruction >> 9) & 0x7
-	pcOffset := signExtend(v.currentInstruction&0x1ff, 9)
+	pcOffset := SignExtend(v.currentInstruction&0x1ff, 9)
 	v.RAM.Write(v.registers[R_PC]+pcOffset, v.registers[r0])
 }
 
 func (v *LC3CPU) storeIndirect() {
 	r0 := (v.currentInstruction >> 9) & 0x7
-	pcOffset := signExtend(v.currentInstruction&0x1ff, 9)
+	pcOffset := SignExtend(v.currentInstruction&0x1ff, 9)
 	v.RAM.Write(v.RAM.Read(v.registers[R_PC]+pcOffset), v.registers[r0])
 }
 
 func (v *LC3CPU) storeRegister() {
 	r0 := (v.currentInstruction >> 9) & 0x7
 	r1 := (v.currentInstruction >> 6) & 0x7
-	offset := signExtend(v.currentInstruction&0x3F, 6)
+	offset := SignExtend(v.currentInstruction&0x3F, 6)
 	v.RAM.Write(v.registers[r1]+offset, v.registers[r0])
 }
 
@@ -342,7 +580,9 @@ func (v *LC3CPU) trapHalt() {
 	v.isRunning = false
 }
 
-func signExtend(x uint16, bitCount int) uint16 {
+// SignExtend sign-extends the low bitCount bits of x to a full uint16,
+// the way immediates and PCoffsets are packed into an instruction word.
+func SignExtend(x uint16, bitCount int) uint16 {
 	if (x>>(bitCount-1))&1 == 1 {
 		x |= 0xFFFF << bitCount
 	}
@@ -0,0 +1,122 @@
+package vm
+
+import (
+	"io"
+	"testing"
+)
+
+func newTestCPU() *LC3CPU {
+	ram := NewRAM(func() bool { return false }, func() uint16 { return 0 })
+	return NewCPU(ram, io.Discard)
+}
+
+func TestInterruptPushesStateAndJumpsThroughVector(t *testing.T) {
+	cpu := newTestCPU()
+	cpu.SetRegister(R_PC, 0x3000)
+	cpu.SetRegister(R_R6, USP_START)
+	cpu.RAM.Write(InterruptVectorTableBase+uint16(VecKeyboard), 0x4000)
+
+	cpu.Interrupt(VecKeyboard, PLKeyboard)
+
+	if pc := cpu.PC(); pc != 0x4000 {
+		t.Fatalf("PC = %#x, want %#x", pc, 0x4000)
+	}
+	psr := cpu.Registers()[R_PSR]
+	if psr&PSR_USER_MODE != 0 {
+		t.Errorf("PSR_USER_MODE still set after Interrupt, want supervisor mode")
+	}
+	if got := uint8((psr & PSR_PRIORITY_MASK) >> PSR_PRIORITY_SHIFT); got != PLKeyboard {
+		t.Errorf("priority = %d, want %d", got, PLKeyboard)
+	}
+	if sp := cpu.Registers()[R_R6]; sp != SSP_START-2 {
+		t.Fatalf("R6 = %#x, want %#x", sp, SSP_START-2)
+	}
+	if got := cpu.RAM.Storage[SSP_START-2]; got != 0x3000 {
+		t.Errorf("pushed PC = %#x, want %#x", got, 0x3000)
+	}
+}
+
+func TestInterruptIgnoresLowerOrEqualPriority(t *testing.T) {
+	cpu := newTestCPU()
+	cpu.SetRegister(R_PC, 0x3000)
+	cpu.SetRegister(R_R6, USP_START)
+	cpu.RAM.Write(InterruptVectorTableBase+uint16(VecKeyboard), 0x4000)
+	cpu.Interrupt(VecKeyboard, PLKeyboard)
+	if pc := cpu.PC(); pc != 0x4000 {
+		t.Fatalf("setup: PC = %#x, want %#x", pc, 0x4000)
+	}
+
+	cpu.RAM.Write(InterruptVectorTableBase+0x90, 0x5000)
+	cpu.Interrupt(0x90, PLKeyboard) // same priority as the pending interrupt, must be ignored
+
+	if pc := cpu.PC(); pc != 0x4000 {
+		t.Errorf("PC changed on equal-priority interrupt: %#x", pc)
+	}
+}
+
+// TestRegisterTrapOverridesBuiltin checks that RegisterTrap can replace
+// one of the built-in OS trap routines, not just add new ones.
+func TestRegisterTrapOverridesBuiltin(t *testing.T) {
+	cpu := newTestCPU()
+	cpu.SetRegister(R_PC, 0x3000)
+	cpu.RAM.Write(0x3000, OP_TRAP<<12|uint16(TRAP_HALT))
+
+	called := false
+	cpu.RegisterTrap(TRAP_HALT, func(cpu *LC3CPU) {
+		called = true
+		cpu.isRunning = false
+	})
+
+	cpu.isRunning = true
+	cpu.Step()
+
+	if !called {
+		t.Errorf("overriding handler for TRAP_HALT was not invoked")
+	}
+	if cpu.isRunning {
+		t.Errorf("isRunning = true after overridden HALT handler cleared it")
+	}
+}
+
+// TestRegisterTrapAddsNewVector checks that RegisterTrap can install a
+// handler for a vector none of the built-in traps use.
+func TestRegisterTrapAddsNewVector(t *testing.T) {
+	cpu := newTestCPU()
+	cpu.SetRegister(R_PC, 0x3000)
+	const customVector = 0x50
+	cpu.RAM.Write(0x3000, OP_TRAP<<12|customVector)
+
+	var got uint16
+	cpu.RegisterTrap(customVector, func(cpu *LC3CPU) {
+		got = cpu.Registers()[R_R0]
+	})
+	cpu.SetRegister(R_R0, 0x42)
+
+	cpu.isRunning = true
+	cpu.Step()
+
+	if got != 0x42 {
+		t.Errorf("custom trap handler saw R0 = %#x, want 0x42", got)
+	}
+}
+
+func TestRTIRestoresUserModeAndStack(t *testing.T) {
+	cpu := newTestCPU()
+	cpu.SetRegister(R_PC, 0x3000)
+	cpu.SetRegister(R_R6, USP_START)
+	cpu.RAM.Write(InterruptVectorTableBase+uint16(VecKeyboard), 0x4000)
+	cpu.RAM.Write(0x4000, OP_RTI<<12)
+
+	cpu.Interrupt(VecKeyboard, PLKeyboard)
+	cpu.Step()
+
+	if pc := cpu.PC(); pc != 0x3000 {
+		t.Fatalf("PC after RTI = %#x, want %#x", pc, 0x3000)
+	}
+	if psr := cpu.Registers()[R_PSR]; psr&PSR_USER_MODE == 0 {
+		t.Errorf("PSR_USER_MODE not restored after RTI")
+	}
+	if sp := cpu.Registers()[R_R6]; sp != USP_START {
+		t.Errorf("R6 after RTI = %#x, want %#x", sp, USP_START)
+	}
+}
@@ -0,0 +1,151 @@
+package vm
+
+// Watchpoint selects which kinds of access to an address should be
+// reported through Debugger's watchpoint callback, see SetWatchpoint.
+type Watchpoint struct {
+	OnRead  bool
+	OnWrite bool
+}
+
+// memChange is one plain-RAM write made during a single Step, recorded so
+// StepBack can undo it.
+type memChange struct {
+	addr   uint16
+	oldVal uint16
+}
+
+// stepSnapshot is enough to undo a single Step: the register file and
+// saved supervisor/user stack pointers before the step ran, plus the
+// plain-RAM writes it made, oldest first.
+type stepSnapshot struct {
+	registers [R_COUNT]uint16
+	ssp, usp  uint16
+	isRunning bool
+	changes   []memChange
+}
+
+// Debugger wraps an LC3CPU with breakpoints, watchpoints, and a bounded
+// reverse-step history, for building interactive REPLs/TUIs over the VM.
+// It drives the CPU one Step at a time rather than calling Run, so it can
+// stop at breakpoints and record undo history along the way.
+type Debugger struct {
+	CPU *LC3CPU
+
+	breakpoints map[uint16]bool
+	watchpoints map[uint16]Watchpoint
+	onWatch     func(addr, val uint16, write bool)
+
+	history    []stepSnapshot
+	historyCap int
+	recording  *stepSnapshot
+}
+
+// NewDebugger wraps cpu with a Debugger whose reverse-step history holds
+// up to historyCap steps.
+func NewDebugger(cpu *LC3CPU, historyCap int) *Debugger {
+	d := &Debugger{
+		CPU:         cpu,
+		breakpoints: make(map[uint16]bool),
+		watchpoints: make(map[uint16]Watchpoint),
+		historyCap:  historyCap,
+	}
+	cpu.RAM.SetWriteHook(d.recordWrite)
+	cpu.RAM.SetReadHook(d.recordRead)
+	return d
+}
+
+// SetBreakpoint pauses Continue whenever the PC reaches addr.
+func (d *Debugger) SetBreakpoint(addr uint16) {
+	d.breakpoints[addr] = true
+}
+
+// ClearBreakpoint removes a breakpoint set with SetBreakpoint.
+func (d *Debugger) ClearBreakpoint(addr uint16) {
+	delete(d.breakpoints, addr)
+}
+
+// SetWatchpoint reports reads and/or writes to addr through the callback
+// registered with OnWatchpoint.
+func (d *Debugger) SetWatchpoint(addr uint16, onRead, onWrite bool) {
+	d.watchpoints[addr] = Watchpoint{OnRead: onRead, OnWrite: onWrite}
+}
+
+// ClearWatchpoint removes a watchpoint set with SetWatchpoint.
+func (d *Debugger) ClearWatchpoint(addr uint16) {
+	delete(d.watchpoints, addr)
+}
+
+// OnWatchpoint registers the callback invoked whenever a watched address
+// is accessed, with the value involved and whether it was a write.
+func (d *Debugger) OnWatchpoint(h func(addr, val uint16, write bool)) {
+	d.onWatch = h
+}
+
+// Step executes a single instruction, recording it in the reverse-step
+// history, and returns whether the CPU is still running afterwards.
+func (d *Debugger) Step() bool {
+	snap := stepSnapshot{
+		registers: d.CPU.registers,
+		ssp:       d.CPU.ssp,
+		usp:       d.CPU.usp,
+		isRunning: d.CPU.isRunning,
+	}
+	d.recording = &snap
+	running := d.CPU.Step()
+	d.recording = nil
+
+	d.history = append(d.history, snap)
+	if len(d.history) > d.historyCap {
+		d.history = d.history[len(d.history)-d.historyCap:]
+	}
+	return running
+}
+
+// StepBack undoes the most recent Step, restoring the register file and
+// any plain-RAM writes it made. It returns false if there is no history
+// left to rewind.
+func (d *Debugger) StepBack() bool {
+	if len(d.history) == 0 {
+		return false
+	}
+
+	snap := d.history[len(d.history)-1]
+	d.history = d.history[:len(d.history)-1]
+
+	for i := len(snap.changes) - 1; i >= 0; i-- {
+		c := snap.changes[i]
+		d.CPU.RAM.Storage[c.addr] = c.oldVal
+	}
+	d.CPU.registers = snap.registers
+	d.CPU.ssp = snap.ssp
+	d.CPU.usp = snap.usp
+	d.CPU.isRunning = snap.isRunning
+	return true
+}
+
+// Continue runs Step until the PC reaches a breakpoint or the CPU stops.
+func (d *Debugger) Continue() {
+	for {
+		if !d.Step() {
+			return
+		}
+		if d.breakpoints[d.CPU.PC()] {
+			return
+		}
+	}
+}
+
+func (d *Debugger) recordWrite(addr, oldVal, newVal uint16) {
+	if d.recording != nil {
+		d.recording.changes = append(d.recording.changes, memChange{addr: addr, oldVal: oldVal})
+	}
+	if wp, ok := d.watchpoints[addr]; ok && wp.OnWrite && d.onWatch != nil {
+		d.onWatch(addr, newVal, true)
+	}
+}
+
+func (d *Debugger) recordRead(addr, val uint16) {
+	if wp, ok := d.watchpoints[addr]; ok && wp.OnRead && d.onWatch != nil {
+		d.onWatch(addr, val, false)
+	}
+}
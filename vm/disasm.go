@@ -0,0 +1,90 @@
+package vm
+
+import "fmt"
+
+// Disassemble decodes the instruction word stored at addr into its
+// assembly mnemonic. It reads the word directly, without going through
+// the device bus, so disassembling an MMIO address never triggers a
+// device side effect.
+func (v *LC3CPU) Disassemble(addr uint16) string {
+	return DisassembleWord(v.RAM.Storage[addr])
+}
+
+// DisassembleWord decodes instr into its assembly mnemonic. TRAP always
+// renders as its raw "TRAP xNN" form; asm.Disassemble builds on this to
+// additionally resolve the standard OS trap aliases (GETC, OUT, ...).
+func DisassembleWord(instr uint16) string {
+	op := instr >> 12
+	r0 := (instr >> 9) & 0x7
+	r1 := (instr >> 6) & 0x7
+	r2 := instr & 0x7
+	imm5 := int16(SignExtend(instr&0x1F, 5))
+	pcOffset9 := int16(SignExtend(instr&0x1ff, 9))
+	pcOffset11 := int16(SignExtend(instr&0x7ff, 11))
+	offset6 := int16(SignExtend(instr&0x3F, 6))
+
+	switch op {
+	case OP_ADD:
+		if (instr>>5)&0x1 == 1 {
+			return fmt.Sprintf("ADD R%d, R%d, #%d", r0, r1, imm5)
+		}
+		return fmt.Sprintf("ADD R%d, R%d, R%d", r0, r1, r2)
+	case OP_AND:
+		if (instr>>5)&0x1 == 1 {
+			return fmt.Sprintf("AND R%d, R%d, #%d", r0, r1, imm5)
+		}
+		return fmt.Sprintf("AND R%d, R%d, R%d", r0, r1, r2)
+	case OP_NOT:
+		return fmt.Sprintf("NOT R%d, R%d", r0, r1)
+	case OP_BR:
+		return fmt.Sprintf("BR%s #%d", condMnemonic((instr>>9)&0x7), pcOffset9)
+	case OP_JMP:
+		if r1 == 7 {
+			return "RET"
+		}
+		return fmt.Sprintf("JMP R%d", r1)
+	case OP_JSR:
+		if (instr>>11)&0x1 == 1 {
+			return fmt.Sprintf("JSR #%d", pcOffset11)
+		}
+		return fmt.Sprintf("JSRR R%d", r1)
+	case OP_LD:
+		return fmt.Sprintf("LD R%d, #%d", r0, pcOffset9)
+	case OP_LDI:
+		return fmt.Sprintf("LDI R%d, #%d", r0, pcOffset9)
+	case OP_LDR:
+		return fmt.Sprintf("LDR R%d, R%d, #%d", r0, r1, offset6)
+	case OP_LEA:
+		return fmt.Sprintf("LEA R%d, #%d", r0, pcOffset9)
+	case OP_ST:
+		return fmt.Sprintf("ST R%d, #%d", r0, pcOffset9)
+	case OP_STI:
+		return fmt.Sprintf("STI R%d, #%d", r0, pcOffset9)
+	case OP_STR:
+		return fmt.Sprintf("STR R%d, R%d, #%d", r0, r1, offset6)
+	case OP_TRAP:
+		return fmt.Sprintf("TRAP x%02X", instr&0xFF)
+	case OP_RTI:
+		return "RTI"
+	case OP_RES:
+		return "RESERVED"
+	default:
+		return fmt.Sprintf(".FILL x%04X", instr)
+	}
+}
+
+// condMnemonic renders a BR condition mask (FL_NEG|FL_ZRO|FL_POS) as the
+// NZP suffix used in LC-3 assembly, e.g. FL_ZRO|FL_POS -> "ZP".
+func condMnemonic(cond uint16) string {
+	var s string
+	if cond&FL_NEG != 0 {
+		s += "N"
+	}
+	if cond&FL_ZRO != 0 {
+		s += "Z"
+	}
+	if cond&FL_POS != 0 {
+		s += "P"
+	}
+	return s
+}
@@ -0,0 +1,26 @@
+package vm
+
+import (
+	"os"
+	"syscall"
+)
+
+// CheckKeyPressed reports whether a byte is available to read from
+// stdin without blocking, by polling its file descriptor. It is the
+// default CheckKey passed to NewRAM by Reset.
+func CheckKeyPressed() bool {
+	fd := int(os.Stdin.Fd())
+	var fds syscall.FdSet
+	fds.Bits[fd/64] |= 1 << uint(fd%64)
+	tv := syscall.Timeval{}
+	n, err := syscall.Select(fd+1, &fds, nil, nil, &tv)
+	return err == nil && n > 0
+}
+
+// GetCharFromStdin reads and returns a single byte from stdin. It is
+// the default GetChar passed to NewRAM by Reset.
+func GetCharFromStdin() uint16 {
+	var b [1]byte
+	os.Stdin.Read(b[:])
+	return uint16(b[0])
+}
@@ -2,6 +2,7 @@ package vm
 
 import (
 	"encoding/binary"
+	"fmt"
 	"io/ioutil"
 	"log"
 )
@@ -14,30 +15,152 @@ const (
 	MR_KBDR uint16 = 0xfe02 // keyboard data
 )
 
+// KBSR bits.
+const (
+	KBSR_READY uint16 = 1 << 15 // a character is available in KBDR
+	KBSR_IE    uint16 = 1 << 14 // interrupt enable
+)
+
+// pageSize controls the granularity of the device lookup table used by
+// Read/Write to keep the common case (plain RAM) a single indexed load.
+const pageSize = 0x100
+const pageCount = int(MaxMemorySize)/pageSize + 1
+
 type CheckKey func() bool
 type GetChar func() uint16
 
+// WriteHook is notified of every plain-RAM write, with the value it is
+// replacing, before the write takes effect. It does not see writes to
+// attached devices.
+type WriteHook func(addr, oldVal, newVal uint16)
+
+// ReadHook is notified of every plain-RAM read, after the value has been
+// fetched. It does not see reads from attached devices.
+type ReadHook func(addr, val uint16)
+
+// Device is a peripheral that can be mapped into the LC3RAM address space
+// via Attach. Read/Write are only ever called with an address that falls
+// within the range returned by Range.
+type Device interface {
+	Read(addr uint16) uint16
+	Write(addr, val uint16)
+	// Range returns the inclusive [start, end] addresses the device occupies.
+	Range() (start, end uint16)
+}
+
+type deviceMapping struct {
+	name string
+	dev  Device
+}
+
 type LC3RAM struct {
 	CheckKey
 	GetChar
 	Storage [MaxMemorySize]uint16
+
+	devices []deviceMapping
+	// pageDevices indexes devices by page so Read/Write can skip straight
+	// to plain RAM for the vast majority of addresses.
+	pageDevices [pageCount][]Device
+
+	keyboard *KeyboardDevice
+
+	writeHook WriteHook
+	readHook  ReadHook
+}
+
+// Keyboard returns the keyboard device attached by NewRAM, or nil if this
+// LC3RAM was built without one. LC3CPU uses it to wire up keyboard
+// interrupts.
+func (m *LC3RAM) Keyboard() *KeyboardDevice {
+	return m.keyboard
+}
+
+// SetWriteHook installs h to be called on every plain-RAM write. Pass nil
+// to remove it.
+func (m *LC3RAM) SetWriteHook(h WriteHook) {
+	m.writeHook = h
+}
+
+// SetReadHook installs h to be called on every plain-RAM read. Pass nil
+// to remove it.
+func (m *LC3RAM) SetReadHook(h ReadHook) {
+	m.readHook = h
+}
+
+// NewRAM creates a new LC3RAM with the keyboard MMIO registers
+// (MR_KBSR/MR_KBDR) attached as a Device.
+func NewRAM(checkKey CheckKey, getChar GetChar) *LC3RAM {
+	m := &LC3RAM{
+		CheckKey: checkKey,
+		GetChar:  getChar,
+	}
+	kb := NewKeyboardDevice(checkKey, getChar)
+	if err := m.Attach("keyboard-status", kbsrPort{kb: kb}); err != nil {
+		log.Fatalf("Can't attach keyboard device: %v", err)
+	}
+	if err := m.Attach("keyboard-data", kbdrPort{kb: kb}); err != nil {
+		log.Fatalf("Can't attach keyboard device: %v", err)
+	}
+	m.keyboard = kb
+	return m
+}
+
+// Attach maps dev into the address space over the range it reports from
+// Range. It returns an error if that range overlaps a device already
+// attached.
+func (m *LC3RAM) Attach(name string, dev Device) error {
+	start, end := dev.Range()
+	if start > end {
+		return fmt.Errorf("vm: device %q has invalid range [%#x, %#x]", name, start, end)
+	}
+
+	for _, existing := range m.devices {
+		existingStart, existingEnd := existing.dev.Range()
+		if start <= existingEnd && existingStart <= end {
+			return fmt.Errorf("vm: device %q range [%#x, %#x] overlaps device %q range [%#x, %#x]",
+				name, start, end, existing.name, existingStart, existingEnd)
+		}
+	}
+
+	m.devices = append(m.devices, deviceMapping{name: name, dev: dev})
+
+	for p := int(start) / pageSize; p <= int(end)/pageSize; p++ {
+		m.pageDevices[p] = append(m.pageDevices[p], dev)
+	}
+	return nil
 }
 
 func (m *LC3RAM) Write(address, val uint16) {
+	if devs := m.pageDevices[address/pageSize]; devs != nil {
+		for _, dev := range devs {
+			start, end := dev.Range()
+			if address >= start && address <= end {
+				dev.Write(address, val)
+				return
+			}
+		}
+	}
+	if m.writeHook != nil {
+		m.writeHook(address, m.Storage[address], val)
+	}
 	m.Storage[address] = val
 }
 
 func (m *LC3RAM) Read(address uint16) uint16 {
-	if address == MR_KBSR {
-		if m.CheckKey() {
-			m.Storage[MR_KBSR] = 1 << 15
-			// read a single ASCII char
-			m.Storage[MR_KBDR] = m.GetChar()
-		} else {
-			m.Storage[MR_KBSR] = 0
+	if devs := m.pageDevices[address/pageSize]; devs != nil {
+		for _, dev := range devs {
+			start, end := dev.Range()
+			if address >= start && address <= end {
+				return dev.Read(address)
+			}
 		}
 	}
-	return m.Storage[address]
+	val := m.Storage[address]
+	if m.readHook != nil {
+		m.readHook(address, val)
+	}
+	return val
 }
 
 func (m *LC3RAM) Load(path string) {
@@ -52,4 +175,80 @@ func (m *LC3RAM) Load(path string) {
 		m.Storage[origin] = binary.BigEndian.Uint16(b[i : i+2])
 		origin++
 	}
-}
\ No newline at end of file
+}
+
+// KeyboardDevice emulates the keyboard status/data MMIO registers
+// (MR_KBSR/MR_KBDR). It polls CheckKey/GetChar whenever KBSR is read, and
+// also whenever Poll is called, so a CPU can notice a key arriving even
+// if the running program never reads KBSR itself.
+type KeyboardDevice struct {
+	CheckKey
+	GetChar
+
+	status      uint16
+	data        uint16
+	onInterrupt func()
+}
+
+// NewKeyboardDevice creates a keyboard device backed by the given
+// CheckKey/GetChar callbacks.
+func NewKeyboardDevice(checkKey CheckKey, getChar GetChar) *KeyboardDevice {
+	return &KeyboardDevice{CheckKey: checkKey, GetChar: getChar}
+}
+
+// SetInterruptHandler installs h to be called whenever a key becomes
+// available while KBSR_IE is set. Pass nil to remove it.
+func (k *KeyboardDevice) SetInterruptHandler(h func()) {
+	k.onInterrupt = h
+}
+
+// Poll checks for a newly available key, latching KBSR_READY and raising
+// an interrupt if KBSR_IE is set. A CPU calls this once per Step.
+func (k *KeyboardDevice) Poll() {
+	if k.status&KBSR_READY != 0 || !k.CheckKey() {
+		return
+	}
+	k.status |= KBSR_READY
+	k.data = k.GetChar()
+	if k.status&KBSR_IE != 0 && k.onInterrupt != nil {
+		k.onInterrupt()
+	}
+}
+
+// readStatus implements MR_KBSR's read side: polling for a newly
+// available key, then returning the (possibly just-updated) status.
+func (k *KeyboardDevice) readStatus() uint16 {
+	k.Poll()
+	return k.status
+}
+
+func (k *KeyboardDevice) writeStatus(val uint16) {
+	k.status = val
+}
+
+// readData implements MR_KBDR's read side: handing back the latched key
+// and clearing KBSR_READY, so the next Poll can latch a new one.
+func (k *KeyboardDevice) readData() uint16 {
+	k.status &^= KBSR_READY
+	return k.data
+}
+
+func (k *KeyboardDevice) writeData(val uint16) {
+	k.data = val
+}
+
+// kbsrPort and kbdrPort map KeyboardDevice's status and data registers
+// into the address space as two single-address Devices, since MR_KBSR
+// and MR_KBDR are not adjacent: 0xFE01 belongs to neither and must stay
+// plain RAM.
+type kbsrPort struct{ kb *KeyboardDevice }
+
+func (p kbsrPort) Range() (start, end uint16) { return MR_KBSR, MR_KBSR }
+func (p kbsrPort) Read(addr uint16) uint16    { return p.kb.readStatus() }
+func (p kbsrPort) Write(addr, val uint16)     { p.kb.writeStatus(val) }
+
+type kbdrPort struct{ kb *KeyboardDevice }
+
+func (p kbdrPort) Range() (start, end uint16) { return MR_KBDR, MR_KBDR }
+func (p kbdrPort) Read(addr uint16) uint16    { return p.kb.readData() }
+func (p kbdrPort) Write(addr, val uint16)     { p.kb.writeData(val) }
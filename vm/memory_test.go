@@ -0,0 +1,97 @@
+package vm
+
+import "testing"
+
+// fixedRangeDevice is a minimal Device for testing Attach, with a
+// hand-picked range and a Read that echoes the address it was asked for.
+type fixedRangeDevice struct {
+	start, end uint16
+	written    map[uint16]uint16
+}
+
+func (d *fixedRangeDevice) Range() (uint16, uint16) { return d.start, d.end }
+func (d *fixedRangeDevice) Read(addr uint16) uint16 { return addr }
+func (d *fixedRangeDevice) Write(addr, val uint16) {
+	if d.written == nil {
+		d.written = make(map[uint16]uint16)
+	}
+	d.written[addr] = val
+}
+
+func TestAttachRejectsOverlappingRange(t *testing.T) {
+	ram := NewRAM(func() bool { return false }, func() uint16 { return 0 })
+	if err := ram.Attach("a", &fixedRangeDevice{start: 0x5000, end: 0x5010}); err != nil {
+		t.Fatalf("Attach(a): %v", err)
+	}
+	if err := ram.Attach("b", &fixedRangeDevice{start: 0x5010, end: 0x5020}); err == nil {
+		t.Errorf("Attach(b) overlapping at 0x5010: want error, got nil")
+	}
+	if err := ram.Attach("c", &fixedRangeDevice{start: 0x5011, end: 0x5030}); err != nil {
+		t.Errorf("Attach(c) adjacent, non-overlapping: %v", err)
+	}
+}
+
+func TestAttachRejectsInvalidRange(t *testing.T) {
+	ram := NewRAM(func() bool { return false }, func() uint16 { return 0 })
+	if err := ram.Attach("backwards", &fixedRangeDevice{start: 0x6010, end: 0x6000}); err == nil {
+		t.Errorf("Attach with start > end: want error, got nil")
+	}
+}
+
+func TestReadWriteRouteThroughAttachedDevice(t *testing.T) {
+	ram := NewRAM(func() bool { return false }, func() uint16 { return 0 })
+	dev := &fixedRangeDevice{start: 0x5000, end: 0x5002}
+	if err := ram.Attach("dev", dev); err != nil {
+		t.Fatalf("Attach: %v", err)
+	}
+
+	for _, addr := range []uint16{0x5000, 0x5001, 0x5002} {
+		if got := ram.Read(addr); got != addr {
+			t.Errorf("Read(%#x) = %#x, want %#x", addr, got, addr)
+		}
+		ram.Write(addr, 0xABCD)
+		if got := dev.written[addr]; got != 0xABCD {
+			t.Errorf("device did not see Write(%#x): got %#x, want 0xABCD", addr, got)
+		}
+	}
+
+	// Addresses just outside the device's range must still be plain RAM.
+	ram.Write(0x4FFF, 0x1111)
+	if got := ram.Read(0x4FFF); got != 0x1111 {
+		t.Errorf("Read(0x4fff) = %#x, want 0x1111 (plain RAM, below device range)", got)
+	}
+	ram.Write(0x5003, 0x2222)
+	if got := ram.Read(0x5003); got != 0x2222 {
+		t.Errorf("Read(0x5003) = %#x, want 0x2222 (plain RAM, above device range)", got)
+	}
+}
+
+// TestKeyboardGapAddressStaysPlainRAM checks that 0xFE01, which falls
+// between MR_KBSR and MR_KBDR but belongs to neither register, is
+// ordinary Storage: a program can use it like any other RAM cell.
+func TestKeyboardGapAddressStaysPlainRAM(t *testing.T) {
+	ram := NewRAM(func() bool { return false }, func() uint16 { return 0 })
+	const gap = MR_KBSR + 1
+
+	ram.Write(gap, 0x1234)
+	if got := ram.Read(gap); got != 0x1234 {
+		t.Errorf("Read(%#x) = %#x, want 0x1234", gap, got)
+	}
+}
+
+func TestKeyboardStatusAndDataRegisters(t *testing.T) {
+	keyAvailable := true
+	ram := NewRAM(func() bool { return keyAvailable }, func() uint16 { return 'A' })
+
+	status := ram.Read(MR_KBSR)
+	if status&KBSR_READY == 0 {
+		t.Fatalf("KBSR_READY not set after polling with a key available")
+	}
+	if data := ram.Read(MR_KBDR); data != 'A' {
+		t.Errorf("KBDR = %q, want 'A'", rune(data))
+	}
+	keyAvailable = false // so the KBSR read below doesn't just latch a new key
+	if status := ram.Read(MR_KBSR); status&KBSR_READY != 0 {
+		t.Errorf("KBSR_READY still set after KBDR was read")
+	}
+}
@@ -0,0 +1,84 @@
+package vm
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// snapshotVersion is bumped whenever the Snapshot/Restore wire format
+// changes, so Restore can reject snapshots it no longer understands.
+const snapshotVersion uint32 = 2
+
+// Snapshot serializes the CPU's full observable state - registers, the
+// saved supervisor/user stack pointers, isRunning, the instruction
+// counter, and RAM contents - to w in a versioned binary format.
+// Attached devices are not part of the snapshot; a Restore'd CPU keeps
+// whatever devices its RAM already had attached.
+func (v *LC3CPU) Snapshot(w io.Writer) error {
+	if err := binary.Write(w, binary.BigEndian, snapshotVersion); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.BigEndian, v.registers); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.BigEndian, v.ssp); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.BigEndian, v.usp); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.BigEndian, v.isRunning); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.BigEndian, v.stepCount); err != nil {
+		return err
+	}
+	return binary.Write(w, binary.BigEndian, v.RAM.Storage)
+}
+
+// Restore replaces the CPU's state with a snapshot previously written by
+// Snapshot. It returns an error if r holds a snapshot of an unsupported
+// version or is otherwise malformed.
+func (v *LC3CPU) Restore(r io.Reader) error {
+	var version uint32
+	if err := binary.Read(r, binary.BigEndian, &version); err != nil {
+		return err
+	}
+	if version != snapshotVersion {
+		return fmt.Errorf("vm: unsupported snapshot version %d", version)
+	}
+
+	var registers [R_COUNT]uint16
+	var ssp, usp uint16
+	var isRunning bool
+	var stepCount uint64
+	var storage [MaxMemorySize]uint16
+
+	if err := binary.Read(r, binary.BigEndian, &registers); err != nil {
+		return err
+	}
+	if err := binary.Read(r, binary.BigEndian, &ssp); err != nil {
+		return err
+	}
+	if err := binary.Read(r, binary.BigEndian, &usp); err != nil {
+		return err
+	}
+	if err := binary.Read(r, binary.BigEndian, &isRunning); err != nil {
+		return err
+	}
+	if err := binary.Read(r, binary.BigEndian, &stepCount); err != nil {
+		return err
+	}
+	if err := binary.Read(r, binary.BigEndian, &storage); err != nil {
+		return err
+	}
+
+	v.registers = registers
+	v.ssp = ssp
+	v.usp = usp
+	v.isRunning = isRunning
+	v.stepCount = stepCount
+	v.RAM.Storage = storage
+	return nil
+}
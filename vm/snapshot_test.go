@@ -0,0 +1,101 @@
+package vm
+
+import (
+	"bytes"
+	"testing"
+)
+
+// TestSnapshotRestoreRoundTrip checks that Restore reproduces the exact
+// state Snapshot captured, after the live CPU has moved on from it.
+func TestSnapshotRestoreRoundTrip(t *testing.T) {
+	cpu := newTestCPU()
+	cpu.SetRegister(R_PC, 0x3000)
+	cpu.SetRegister(R_R0, 0x42)
+	cpu.RAM.Write(0x3000, OP_ADD<<12|0<<9|0<<6|1<<5|1) // ADD R0, R0, #1
+	cpu.isRunning = true
+	cpu.stepCount = 7
+
+	var buf bytes.Buffer
+	if err := cpu.Snapshot(&buf); err != nil {
+		t.Fatalf("Snapshot: %v", err)
+	}
+	wantRegisters := cpu.registers
+	wantSSP, wantUSP := cpu.ssp, cpu.usp
+	wantStepCount := cpu.stepCount
+	wantStorage := cpu.RAM.Storage
+
+	// Mutate the live CPU so Restore has something to undo.
+	cpu.Step()
+	cpu.SetRegister(R_R1, 0xBEEF)
+	cpu.RAM.Write(0x3005, 0x1234)
+
+	if err := cpu.Restore(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+
+	if cpu.registers != wantRegisters {
+		t.Errorf("registers after Restore = %v, want %v", cpu.registers, wantRegisters)
+	}
+	if cpu.ssp != wantSSP || cpu.usp != wantUSP {
+		t.Errorf("ssp/usp after Restore = %#x/%#x, want %#x/%#x", cpu.ssp, cpu.usp, wantSSP, wantUSP)
+	}
+	if cpu.stepCount != wantStepCount {
+		t.Errorf("stepCount after Restore = %d, want %d", cpu.stepCount, wantStepCount)
+	}
+	if cpu.RAM.Storage != wantStorage {
+		t.Errorf("RAM contents after Restore do not match the snapshot")
+	}
+	if !cpu.isRunning {
+		t.Errorf("isRunning after Restore = false, want true")
+	}
+}
+
+func TestRestoreRejectsUnsupportedVersion(t *testing.T) {
+	cpu := newTestCPU()
+	buf := bytes.NewReader([]byte{0, 0, 0, 99}) // bogus version, no further payload
+	if err := cpu.Restore(buf); err == nil {
+		t.Errorf("Restore with unsupported version: want error, got nil")
+	}
+}
+
+// TestRunUntilStopsAtStepCount checks that RunUntil stops exactly at the
+// requested instruction count rather than running to completion.
+func TestRunUntilStopsAtStepCount(t *testing.T) {
+	cpu := newTestCPU()
+	cpu.StartPosition = 0x3000
+	for addr := uint16(0x3000); addr < 0x3010; addr++ {
+		cpu.RAM.Write(addr, OP_ADD<<12|0<<9|0<<6|1<<5|1) // ADD R0, R0, #1
+	}
+
+	cpu.RunUntil(5)
+
+	if got := cpu.StepCount(); got != 5 {
+		t.Fatalf("StepCount after RunUntil(5) = %d, want 5", got)
+	}
+	if !cpu.isRunning {
+		t.Errorf("isRunning = false after RunUntil stopped short of a HALT")
+	}
+	if got := cpu.Registers()[R_R0]; got != 5 {
+		t.Errorf("R0 after 5 ADDs = %d, want 5", got)
+	}
+}
+
+// TestRunForRunsNMoreInstructions checks that RunFor advances by n
+// instructions from wherever stepCount currently is, not from zero.
+func TestRunForRunsNMoreInstructions(t *testing.T) {
+	cpu := newTestCPU()
+	cpu.StartPosition = 0x3000
+	for addr := uint16(0x3000); addr < 0x3010; addr++ {
+		cpu.RAM.Write(addr, OP_ADD<<12|0<<9|0<<6|1<<5|1) // ADD R0, R0, #1
+	}
+
+	cpu.RunUntil(3)
+	cpu.RunFor(4)
+
+	if got := cpu.StepCount(); got != 7 {
+		t.Fatalf("StepCount after RunUntil(3) then RunFor(4) = %d, want 7", got)
+	}
+	if got := cpu.Registers()[R_R0]; got != 7 {
+		t.Errorf("R0 after 7 ADDs = %d, want 7", got)
+	}
+}
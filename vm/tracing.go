@@ -0,0 +1,127 @@
+package vm
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Tracer receives execution events from LC3CPU as it runs, see
+// LC3CPU.SetTracer. Its methods are called synchronously from Step, so
+// implementations must not block or mutate CPU state.
+type Tracer interface {
+	// OnFetch is called once per Step, right after an instruction word
+	// is fetched from pc.
+	OnFetch(pc, instr uint16)
+	// OnMemRead is called whenever plain RAM is read, via the same
+	// LC3RAM read hook a Debugger uses for watchpoints: this includes
+	// the instruction fetch itself, so a fetch is reported through both
+	// OnFetch and OnMemRead. Like that hook, it does not see reads from
+	// attached devices (e.g. the keyboard's status/data registers).
+	OnMemRead(addr, val uint16)
+	// OnMemWrite is called whenever plain RAM is written, via the same
+	// LC3RAM write hook a Debugger uses for undo. It does not see writes
+	// to attached devices.
+	OnMemWrite(addr, val uint16)
+	// OnTrap is called when a TRAP instruction executes, before its
+	// handler runs.
+	OnTrap(vector uint8)
+}
+
+// DisasmTracer writes a human-readable disassembly log to w, one line
+// per instruction fetched.
+type DisasmTracer struct {
+	w io.Writer
+}
+
+// NewDisasmTracer creates a DisasmTracer that writes to w.
+func NewDisasmTracer(w io.Writer) *DisasmTracer {
+	return &DisasmTracer{w: w}
+}
+
+func (t *DisasmTracer) OnFetch(pc, instr uint16) {
+	fmt.Fprintf(t.w, "x%04X: %s\n", pc, DisassembleWord(instr))
+}
+
+func (t *DisasmTracer) OnMemRead(addr, val uint16)  {}
+func (t *DisasmTracer) OnMemWrite(addr, val uint16) {}
+func (t *DisasmTracer) OnTrap(vector uint8)         {}
+
+// TraceEvent is one event emitted by JSONTracer. Which fields beyond
+// Type are populated depends on the event: fetch sets PC/Instr, the
+// memory events set Addr/Val, trap sets Vector.
+type TraceEvent struct {
+	Type   string `json:"type"`
+	PC     uint16 `json:"pc,omitempty"`
+	Instr  uint16 `json:"instr,omitempty"`
+	Addr   uint16 `json:"addr,omitempty"`
+	Val    uint16 `json:"val,omitempty"`
+	Vector uint8  `json:"vector,omitempty"`
+}
+
+// JSONTracer writes a newline-delimited JSON stream of TraceEvents to w,
+// one per fetch, memory access, or trap.
+type JSONTracer struct {
+	enc *json.Encoder
+}
+
+// NewJSONTracer creates a JSONTracer that writes to w.
+func NewJSONTracer(w io.Writer) *JSONTracer {
+	return &JSONTracer{enc: json.NewEncoder(w)}
+}
+
+func (t *JSONTracer) OnFetch(pc, instr uint16) {
+	t.enc.Encode(TraceEvent{Type: "fetch", PC: pc, Instr: instr})
+}
+
+func (t *JSONTracer) OnMemRead(addr, val uint16) {
+	t.enc.Encode(TraceEvent{Type: "mem_read", Addr: addr, Val: val})
+}
+
+func (t *JSONTracer) OnMemWrite(addr, val uint16) {
+	t.enc.Encode(TraceEvent{Type: "mem_write", Addr: addr, Val: val})
+}
+
+func (t *JSONTracer) OnTrap(vector uint8) {
+	t.enc.Encode(TraceEvent{Type: "trap", Vector: vector})
+}
+
+// CoverageTracer counts how many times each address is fetched, and
+// dumps the hit counts to w, sorted by address, as soon as a HALT trap
+// fires.
+type CoverageTracer struct {
+	w    io.Writer
+	hits map[uint16]uint64
+}
+
+// NewCoverageTracer creates a CoverageTracer that dumps to w.
+func NewCoverageTracer(w io.Writer) *CoverageTracer {
+	return &CoverageTracer{w: w, hits: make(map[uint16]uint64)}
+}
+
+func (t *CoverageTracer) OnFetch(pc, instr uint16) {
+	t.hits[pc]++
+}
+
+func (t *CoverageTracer) OnMemRead(addr, val uint16)  {}
+func (t *CoverageTracer) OnMemWrite(addr, val uint16) {}
+
+func (t *CoverageTracer) OnTrap(vector uint8) {
+	if vector == TRAP_HALT {
+		t.Dump()
+	}
+}
+
+// Dump writes the current hit counts to w, one "xADDR: count" line per
+// address that was ever fetched, sorted by address.
+func (t *CoverageTracer) Dump() {
+	addrs := make([]uint16, 0, len(t.hits))
+	for addr := range t.hits {
+		addrs = append(addrs, addr)
+	}
+	sort.Slice(addrs, func(i, j int) bool { return addrs[i] < addrs[j] })
+	for _, addr := range addrs {
+		fmt.Fprintf(t.w, "x%04X: %d\n", addr, t.hits[addr])
+	}
+}
@@ -0,0 +1,95 @@
+package vm
+
+import (
+	"io"
+	"testing"
+)
+
+type recordingTracer struct {
+	fetches []uint16 // pc of each OnFetch
+	reads   []uint16 // addr of each OnMemRead
+	writes  []uint16 // addr of each OnMemWrite
+	traps   []uint8
+}
+
+func (r *recordingTracer) OnFetch(pc, instr uint16)   { r.fetches = append(r.fetches, pc) }
+func (r *recordingTracer) OnMemRead(addr, val uint16) { r.reads = append(r.reads, addr) }
+func (r *recordingTracer) OnMemWrite(addr, val uint16) {
+	r.writes = append(r.writes, addr)
+}
+func (r *recordingTracer) OnTrap(vector uint8) { r.traps = append(r.traps, vector) }
+
+// TestSetTracerObservesFetchAndMemoryEvents checks that a Tracer sees the
+// same fetch/read/write events OnInstruction and the RAM hooks already
+// expose, since SetTracer is implemented in terms of them rather than a
+// second, independent observation mechanism.
+func TestSetTracerObservesFetchAndMemoryEvents(t *testing.T) {
+	ram := NewRAM(func() bool { return false }, func() uint16 { return 0 })
+	cpu := NewCPU(ram, io.Discard)
+	cpu.SetRegister(R_PC, 0x3000)
+	ram.Write(0x3000, (OP_ST<<12)|(0<<9)|1) // ST R0, #1 -> writes to 0x3002
+	ram.Write(0x3001, OP_TRAP<<12|uint16(TRAP_HALT))
+
+	tr := &recordingTracer{}
+	cpu.SetTracer(tr)
+
+	cpu.Step() // ST
+	cpu.Step() // TRAP HALT
+
+	if len(tr.fetches) != 2 || tr.fetches[0] != 0x3000 || tr.fetches[1] != 0x3001 {
+		t.Errorf("fetches = %v, want [0x3000 0x3001]", tr.fetches)
+	}
+	// Fetches are plain-RAM reads too, so they show up in OnMemRead
+	// alongside OnFetch.
+	if len(tr.reads) != 2 || tr.reads[0] != 0x3000 || tr.reads[1] != 0x3001 {
+		t.Errorf("reads = %v, want [0x3000 0x3001]", tr.reads)
+	}
+	if len(tr.writes) != 1 || tr.writes[0] != 0x3002 {
+		t.Errorf("writes = %v, want [0x3002]", tr.writes)
+	}
+	if len(tr.traps) != 1 || tr.traps[0] != TRAP_HALT {
+		t.Errorf("traps = %v, want [%#x]", tr.traps, TRAP_HALT)
+	}
+}
+
+// TestSetTracerDoesNotSeeDeviceAccess checks that, like the RAM hooks it
+// is built on, a Tracer only observes plain-RAM traffic: device-mapped
+// reads/writes (e.g. the keyboard's status register) never reach it.
+func TestSetTracerDoesNotSeeDeviceAccess(t *testing.T) {
+	ram := NewRAM(func() bool { return false }, func() uint16 { return 0 })
+	cpu := NewCPU(ram, io.Discard)
+	cpu.SetRegister(R_PC, 0x3000)
+	ram.Write(0x3000, (OP_LDI<<12)|(0<<9)) // LDI R0, #0 -> indirects through MR_KBSR
+
+	tr := &recordingTracer{}
+	cpu.SetTracer(tr)
+	ram.Storage[0x3000+1] = MR_KBSR // the PCoffset9 computed address holds the KBSR pointer
+
+	cpu.Step()
+
+	for _, addr := range tr.reads {
+		if addr == MR_KBSR {
+			t.Errorf("OnMemRead reported a device-bus address %#x, want plain-RAM reads only", addr)
+		}
+	}
+}
+
+// TestSetTracerNilClearsUnderlyingHooks checks that SetTracer(nil) tears
+// down the hooks it installed, matching OnInstruction/SetWriteHook/
+// SetReadHook's own "pass nil to remove" convention.
+func TestSetTracerNilClearsUnderlyingHooks(t *testing.T) {
+	ram := NewRAM(func() bool { return false }, func() uint16 { return 0 })
+	cpu := NewCPU(ram, io.Discard)
+	cpu.SetRegister(R_PC, 0x3000)
+	ram.Write(0x3000, OP_TRAP<<12|uint16(TRAP_HALT))
+
+	tr := &recordingTracer{}
+	cpu.SetTracer(tr)
+	cpu.SetTracer(nil)
+
+	cpu.Step()
+
+	if len(tr.fetches) != 0 {
+		t.Errorf("fetches recorded after SetTracer(nil): %v", tr.fetches)
+	}
+}